@@ -25,31 +25,39 @@ import (
 )
 
 var (
-	app              = kingpin.New("goad", "An AWS Lambda powered load testing tool")
-	urlFlag          = app.Flag("url", "URL to load test").Short('u')
-	url              = urlFlag.String()
-	methodFlag       = app.Flag("method", "HTTP method").Short('m').Default("GET")
-	method           = methodFlag.String()
-	bodyFlag         = app.Flag("body", "HTTP request body").Short('b')
-	body             = bodyFlag.String()
-	concurrencyFlag  = app.Flag("concurrency", "Number of concurrent requests").Short('c').Default("10")
-	concurrency      = concurrencyFlag.Int()
-	requestsFlag     = app.Flag("requests", "Total number of requests to make").Short('n').Default("1000")
-	requests         = requestsFlag.Int()
-	timelimitFlag    = app.Flag("timelimit", "Seconds to max. to spend on benchmarking").Short('N').Default("3600")
-	timelimit        = timelimitFlag.Int()
-	timeoutFlag      = app.Flag("timeout", "Request timeout in seconds").Short('t').Default("15")
-	timeout          = timeoutFlag.Int()
-	regionsFlag      = app.Flag("region", "AWS regions to run in (repeat flag to run in more then one region)").Short('r')
-	regions          = regionsFlag.Strings()
-	awsProfileFlag   = app.Flag("awsprofile", "AWS named profile to use").Short('p')
-	awsProfile       = awsProfileFlag.String()
-	outputFileFlag   = app.Flag("output", "Optional path to JSON file for result storage").Short('o')
-	outputFile       = outputFileFlag.String()
-	headersFlag      = app.Flag("header", "HTTP request header (repeat flag to add more then one header)").Short('H')
-	headers          = headersFlag.Strings()
-	settingsFileFlag = app.Flag("settings", "Load settings from file (defaults to .goad)").Short('s')
-	settingsFile     = settingsFileFlag.ExistingFile()
+	app                = kingpin.New("goad", "An AWS Lambda powered load testing tool")
+	urlFlag            = app.Flag("url", "URL to load test").Short('u')
+	url                = urlFlag.String()
+	methodFlag         = app.Flag("method", "HTTP method").Short('m').Default("GET")
+	method             = methodFlag.String()
+	bodyFlag           = app.Flag("body", "HTTP request body").Short('b')
+	body               = bodyFlag.String()
+	concurrencyFlag    = app.Flag("concurrency", "Number of concurrent requests").Short('c').Default("10")
+	concurrency        = concurrencyFlag.Int()
+	requestsFlag       = app.Flag("requests", "Total number of requests to make").Short('n').Default("1000")
+	requests           = requestsFlag.Int()
+	timelimitFlag      = app.Flag("timelimit", "Seconds to max. to spend on benchmarking").Short('N').Default("3600")
+	timelimit          = timelimitFlag.Int()
+	timeoutFlag        = app.Flag("timeout", "Request timeout in seconds").Short('t').Default("15")
+	timeout            = timeoutFlag.Int()
+	regionsFlag        = app.Flag("region", "AWS regions to run in (repeat flag to run in more then one region)").Short('r')
+	regions            = regionsFlag.Strings()
+	awsProfileFlag     = app.Flag("awsprofile", "AWS named profile to use").Short('p')
+	awsProfile         = awsProfileFlag.String()
+	outputFileFlag     = app.Flag("output", "Optional path to JSON file for result storage").Short('o')
+	outputFile         = outputFileFlag.String()
+	headersFlag        = app.Flag("header", "HTTP request header (repeat flag to add more then one header)").Short('H')
+	headers            = headersFlag.Strings()
+	settingsFileFlag   = app.Flag("settings", "Load settings from file (defaults to .goad)").Short('s')
+	settingsFile       = settingsFileFlag.ExistingFile()
+	promOutputFlag     = app.Flag("prom-output", "Optional path to write results in Prometheus text exposition format")
+	promOutput         = promOutputFlag.String()
+	pushGatewayFlag    = app.Flag("push-gateway", "Prometheus Pushgateway URL to push results to on completion")
+	pushGateway        = pushGatewayFlag.String()
+	pushGatewayJobFlag = app.Flag("push-gateway-job", "Job label to push results under").Default("goad")
+	pushGatewayJob     = pushGatewayJobFlag.String()
+	protocolFlag       = app.Flag("protocol", "Protocol to test: http, tcp or udp").Default("http")
+	protocol           = protocolFlag.String()
 )
 
 const coldef = termbox.ColorDefault
@@ -69,6 +77,14 @@ func main() {
 		defer saveJSONSummary(*outputFile, &finalResult)
 	}
 
+	if config.PromOutput != "" {
+		defer savePrometheusOutput(*promOutput, &finalResult)
+	}
+
+	if config.PushGateway != "" {
+		defer pushToGateway(*pushGateway, config.PushGatewayJob, &finalResult)
+	}
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM) // but interrupts from kbd are blocked by termbox
 
@@ -82,7 +98,12 @@ func aggregateConfiguration() *goad.TestConfig {
 	}
 	config := parseSettingsFile(cmdLineConfig.Settings)
 	applyDefaultsFromConfig(config)
-	return parseCommandline()
+	finalConfig := parseCommandline()
+	// Stages have no CLI flag of their own (a [[stage]] profile only makes
+	// sense in the settings file), so they can't round-trip through
+	// applyDefaultsFromConfig/kingpin defaults like the other fields.
+	finalConfig.Stages = config.Stages
+	return finalConfig
 }
 
 func applyDefaultsFromConfig(config *goad.TestConfig) {
@@ -92,6 +113,10 @@ func applyDefaultsFromConfig(config *goad.TestConfig) {
 	applyDefaultIfNotZero(headersFlag, config.Headers)
 	applyDefaultIfNotZero(methodFlag, config.Method)
 	applyDefaultIfNotZero(outputFileFlag, config.Output)
+	applyDefaultIfNotZero(promOutputFlag, config.PromOutput)
+	applyDefaultIfNotZero(pushGatewayFlag, config.PushGateway)
+	applyDefaultIfNotZero(pushGatewayJobFlag, config.PushGatewayJob)
+	applyDefaultIfNotZero(protocolFlag, config.Protocol)
 	applyDefaultIfNotZero(regionsFlag, config.Regions)
 	applyDefaultIfNotZero(requestsFlag, prepareInt(config.Requests))
 	applyDefaultIfNotZero(timelimitFlag, prepareInt(config.Timelimit))
@@ -163,10 +188,35 @@ func parseSettingsFile(file string) *goad.TestConfig {
 			fmt.Printf("Error parsing settings file: %s\n", fail.Error())
 			os.Exit(1)
 		}
+		if fail := validateStages(config.Stages); fail != nil {
+			fmt.Printf("Error parsing settings file: %s\n", fail.Error())
+			os.Exit(1)
+		}
 	}
 	return config
 }
 
+// validateStages rejects [[stage]] entries that don't describe a pace: each
+// stage needs a duration, a concurrency, and exactly one of a target RPS or
+// a request count.
+func validateStages(stages []goad.Stage) error {
+	for i, stage := range stages {
+		if stage.Duration <= 0 {
+			return fmt.Errorf("stage %d: duration must be greater than 0", i+1)
+		}
+		if stage.Concurrency <= 0 {
+			return fmt.Errorf("stage %d: concurrency must be greater than 0", i+1)
+		}
+		if stage.RPS > 0 && stage.Requests > 0 {
+			return fmt.Errorf("stage %d: set either rps or requests, not both", i+1)
+		}
+		if stage.RPS <= 0 && stage.Requests <= 0 {
+			return fmt.Errorf("stage %d: must set either rps or requests", i+1)
+		}
+	}
+	return nil
+}
+
 func parseCommandline() *goad.TestConfig {
 	args := os.Args[1:]
 
@@ -191,6 +241,10 @@ func parseCommandline() *goad.TestConfig {
 	config.Headers = *headers
 	config.AwsProfile = *awsProfile
 	config.Output = *outputFile
+	config.PromOutput = *promOutput
+	config.PushGateway = *pushGateway
+	config.PushGatewayJob = *pushGatewayJob
+	config.Protocol = *protocol
 	config.Settings = *settingsFile
 	return config
 }
@@ -212,7 +266,56 @@ func createGoadTest(config *goad.TestConfig) *goad.Test {
 	return test
 }
 
+// isTTY reports whether stdout is an interactive terminal. When it isn't
+// (piped to a file, running under CI, etc.) there's no point initializing
+// termbox, so start() falls back to runHeadless instead.
+func isTTY() bool {
+	fi, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// runHeadless drives the test without termbox, still sampling region history
+// on the same 1s ticker so the final ASCII throughput chart and JSON output
+// have a shape-of-the-run view even when there's no TTY to draw one in.
+func runHeadless(test *goad.Test, finalResult *queue.RegionsAggData, sigChan chan os.Signal) {
+	defer test.Clean()
+
+	resultChan := test.Start()
+	latestData := make(map[string]queue.AggData)
+	sampleTicker := time.NewTicker(time.Second)
+	defer sampleTicker.Stop()
+
+	for {
+		select {
+		case now := <-sampleTicker.C:
+			for region, data := range latestData {
+				recordSnapshot(region, data, now)
+			}
+
+		case result, ok := <-resultChan:
+			if !ok {
+				return
+			}
+			for region, data := range result.Regions {
+				latestData[region] = data
+			}
+			finalResult.Regions = result.Regions
+
+		case <-sigChan:
+			return
+		}
+	}
+}
+
 func start(test *goad.Test, finalResult *queue.RegionsAggData, sigChan chan os.Signal) {
+	if !isTTY() {
+		runHeadless(test, finalResult, sigChan)
+		return
+	}
+
 	err := termbox.Init()
 	if err != nil {
 		panic(err)
@@ -228,7 +331,7 @@ func start(test *goad.Test, finalResult *queue.RegionsAggData, sigChan chan os.S
 	resultChan := test.Start()
 
 	_, h := termbox.Size()
-	renderString(0, h-1, "Press ctrl-c to interrupt", coldef, coldef)
+	renderString(0, h-1, "Press ctrl-c to interrupt, r to toggle per-runner detail", coldef, coldef)
 	termbox.Flush()
 
 	go func() {
@@ -237,14 +340,28 @@ func start(test *goad.Test, finalResult *queue.RegionsAggData, sigChan chan os.S
 			if event.Key == 3 {
 				sigChan <- syscall.SIGINT
 			}
+			if event.Ch == 'r' {
+				toggleRunnerPanel()
+			}
 		}
 	}()
 
 	startTime := time.Now()
 	firstTime := true
+	latestData := make(map[string]queue.AggData)
+	sampleTicker := time.NewTicker(time.Second)
+	defer sampleTicker.Stop()
 outer:
 	for {
 		select {
+		case now := <-sampleTicker.C:
+			// Sample on a fixed 1s clock, independent of how often
+			// resultChan delivers messages, so the rolling window and
+			// sparkline really are a 60s/1s-resolution view.
+			for region, data := range latestData {
+				recordSnapshot(region, data, now)
+			}
+
 		case result, ok := <-resultChan:
 			if !ok {
 				break outer
@@ -266,7 +383,8 @@ outer:
 			for _, region := range regions {
 				data := result.Regions[region]
 				totalReqs += data.TotalReqs
-				y = renderRegion(data, y)
+				latestData[region] = data
+				y = renderRegion(data, regionHistories[region], y)
 				y++
 			}
 
@@ -310,7 +428,7 @@ func clearLogo() {
 }
 
 // renderRegion returns the y for the next empty line
-func renderRegion(data queue.AggData, y int) int {
+func renderRegion(data queue.AggData, history *regionHistory, y int) int {
 	x := 0
 	renderString(x, y, "Region: ", termbox.ColorWhite, termbox.ColorBlue)
 	x += 8
@@ -324,16 +442,66 @@ func renderRegion(data queue.AggData, y int) int {
 	resultStr := fmt.Sprintf("%10d %10s   %7.3fs %10.2f %10.2f", data.TotalReqs, humanize.Bytes(uint64(data.TotBytesRead)), float64(data.AveTimeForReq)/nano, data.AveReqPerSec, data.AveKBytesPerSec)
 	renderString(x, y, resultStr, coldef, coldef)
 	y++
-	headingStr = "   Slowest    Fastest   Timeouts  TotErrors"
+	headingStr = fmt.Sprintf("   Slowest    Fastest%s  TotErrors", thirdColumnHeading(data))
 	renderString(x, y, headingStr, coldef|termbox.AttrBold, coldef)
 	y++
-	resultStr = fmt.Sprintf("  %7.3fs   %7.3fs %10d %10d", float64(data.Slowest)/nano, float64(data.Fastest)/nano, data.TotalTimedOut, totErrors(&data))
+	resultStr = fmt.Sprintf("  %7.3fs   %7.3fs %s %10d", float64(data.Slowest)/nano, float64(data.Fastest)/nano, thirdColumnValue(data), totErrors(&data))
 	renderString(x, y, resultStr, coldef, coldef)
 	y++
+	reqPerSec, bytesPerSec, errPerSec := history.rates()
+	sparkStr := fmt.Sprintf("Req/s %s  now %7.1f/s %7.1f KB/s %6.1f err/s", sparkline(history.reqRateSeries()), reqPerSec, bytesPerSec/1024, errPerSec)
+	renderString(x, y, sparkStr, coldef, coldef)
+	y++
+	if data.StageCount > 0 {
+		stageStr := fmt.Sprintf("Stage %d/%d  %6.1fs elapsed   target %7.1f req/s   actual %7.1f req/s",
+			data.CurrentStage+1, data.StageCount, data.StageElapsedSec, data.TargetReqPerSec, data.AveReqPerSec)
+		renderString(x, y, stageStr, coldef, coldef)
+		y++
+	}
+	headingStr = "       p50        p90        p95        p99"
+	renderString(x, y, headingStr, coldef|termbox.AttrBold, coldef)
+	y++
+	p50, p90, p95, p99 := percentilesFromHistogram(data.LatencyHistogram).format()
+	resultStr = fmt.Sprintf("  %9s    %9s    %9s    %9s", p50, p90, p95, p99)
+	renderString(x, y, resultStr, coldef, coldef)
+	y++
+	if runnerPanelVisible() {
+		y = renderRunnerPanel(data, y)
+	}
 
 	return y
 }
 
+// thirdColumnHeading swaps the "Timeouts" column heading for L4 tests:
+// "PktLoss" for UDP, where dropped packets rather than request timeouts are
+// the meaningful signal, and "ConnErrs" for TCP. The TCP column shows the
+// same TotalTimedOut counter that the HTTP "Timeouts" column shows.
+func thirdColumnHeading(data queue.AggData) string {
+	switch data.Protocol {
+	case "udp":
+		return "    PktLoss"
+	case "tcp":
+		return "   ConnErrs"
+	default:
+		return "   Timeouts"
+	}
+}
+
+func thirdColumnValue(data queue.AggData) string {
+	switch data.Protocol {
+	case "udp":
+		var loss float64
+		if data.PacketsSent > 0 {
+			loss = float64(data.PacketsSent-data.PacketsReceived) / float64(data.PacketsSent) * 100
+		}
+		return fmt.Sprintf("%9.2f%%", loss)
+	case "tcp":
+		return fmt.Sprintf("%10d", data.TotalTimedOut)
+	default:
+		return fmt.Sprintf("%10d", data.TotalTimedOut)
+	}
+}
+
 func totErrors(data *queue.AggData) int {
 	var okReqs int
 	for statusStr, value := range data.Statuses {
@@ -376,8 +544,11 @@ func boldPrintln(msg string) {
 func printData(data *queue.AggData) {
 	boldPrintln("   TotReqs   TotBytes    AvgTime   AvgReq/s  AvgKbps/s")
 	fmt.Printf("%10d %10s   %7.3fs %10.2f %10.2f\n", data.TotalReqs, humanize.Bytes(uint64(data.TotBytesRead)), float64(data.AveTimeForReq)/nano, data.AveReqPerSec, data.AveKBytesPerSec)
-	boldPrintln("   Slowest    Fastest   Timeouts  TotErrors")
-	fmt.Printf("  %7.3fs   %7.3fs %10d %10d", float64(data.Slowest)/nano, float64(data.Fastest)/nano, data.TotalTimedOut, totErrors(data))
+	boldPrintln(fmt.Sprintf("   Slowest    Fastest%s  TotErrors", thirdColumnHeading(*data)))
+	fmt.Printf("  %7.3fs   %7.3fs %s %10d\n", float64(data.Slowest)/nano, float64(data.Fastest)/nano, thirdColumnValue(*data), totErrors(data))
+	boldPrintln("       p50        p90        p95        p99")
+	p50, p90, p95, p99 := percentilesFromHistogram(data.LatencyHistogram).format()
+	fmt.Printf("  %9s    %9s    %9s    %9s", p50, p90, p95, p99)
 	fmt.Println("")
 }
 
@@ -392,6 +563,11 @@ func printSummary(result *queue.RegionsAggData) {
 	for region, data := range result.Regions {
 		fmt.Println("Region: " + region)
 		printData(&data)
+		if series := regionHistories[region].reqRateSeries(); len(series) > 0 {
+			boldPrintln("Req/s over time")
+			fmt.Println(asciiChart(series, 8))
+			fmt.Println("")
+		}
 	}
 
 	overall := queue.SumRegionResults(result)
@@ -408,19 +584,41 @@ func printSummary(result *queue.RegionsAggData) {
 	fmt.Println("")
 }
 
+// jsonAggData embeds the raw AggData plus the percentiles computed from its
+// histogram, so JSON consumers don't have to decode the RLE array themselves.
+// RunnerDetails is named to avoid colliding with AggData's own Runners field
+// (queue.RunnerAgg keyed by id) — giving both the same Go field name would
+// make this one silently shadow the embedded one instead of sitting
+// alongside it.
+type jsonAggData struct {
+	queue.AggData
+	Percentiles       latencyPercentiles
+	ReqPerSecOverTime []float64    `json:"reqPerSecOverTime,omitempty"`
+	RunnerDetails     []runnerJSON `json:"runners,omitempty"`
+}
+
+func toJSONAggData(data queue.AggData, region string) jsonAggData {
+	return jsonAggData{
+		AggData:           data,
+		Percentiles:       percentilesFromHistogram(data.LatencyHistogram),
+		ReqPerSecOverTime: regionHistories[region].reqRateSeries(),
+		RunnerDetails:     runnersJSON(data),
+	}
+}
+
 func saveJSONSummary(path string, result *queue.RegionsAggData) {
 	if len(result.Regions) == 0 {
 		return
 	}
-	results := make(map[string]queue.AggData)
+	results := make(map[string]jsonAggData)
 
 	for region, data := range result.Regions {
-		results[region] = data
+		results[region] = toJSONAggData(data, region)
 	}
 
 	overall := queue.SumRegionResults(result)
 
-	results["overall"] = *overall
+	results["overall"] = toJSONAggData(*overall, "overall")
 	b, err := json.MarshalIndent(results, "", "  ")
 	if err != nil {
 		fmt.Println(err)
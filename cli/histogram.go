@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Fixed-bucket log-linear HDR-style histogram used to estimate latency
+// percentiles from a compact counter array instead of keeping every sample.
+// Durations are tracked in nanoseconds across a 1µs-60s range at roughly
+// 3 significant figures of precision.
+const (
+	histogramMinValue       = int64(1000)      // 1 microsecond
+	histogramMaxValue       = int64(60 * nano) // 60 seconds
+	histogramSubBucketCount = 2048
+)
+
+// histogramBucketCount returns the number of power-of-two buckets needed to
+// span [histogramMinValue, histogramMaxValue].
+func histogramBucketCount() int {
+	count := 1
+	for v := histogramMinValue; v*2 <= histogramMaxValue; v *= 2 {
+		count++
+	}
+	return count
+}
+
+// histogramSize is the fixed length of the counter array queue.AggData
+// carries as LatencyHistogram (after RLE decoding).
+func histogramSize() int {
+	return histogramBucketCount() * histogramSubBucketCount
+}
+
+// histogramIndex returns the counter-array index a duration of d nanoseconds
+// falls into: bucket = floor(log2(d/min)), subBucket = linear offset within
+// that power-of-two range.
+func histogramIndex(d int64) int {
+	if d < histogramMinValue {
+		d = histogramMinValue
+	}
+	if d > histogramMaxValue {
+		d = histogramMaxValue
+	}
+	bucket := 0
+	base := histogramMinValue
+	for base*2 <= d {
+		base *= 2
+		bucket++
+	}
+	subBucket := int((d - base) * histogramSubBucketCount / base)
+	if subBucket >= histogramSubBucketCount {
+		subBucket = histogramSubBucketCount - 1
+	}
+	return bucket*histogramSubBucketCount + subBucket
+}
+
+// histogramMidpoint returns the representative duration, in nanoseconds, for
+// a given counter-array index.
+func histogramMidpoint(index int) int64 {
+	bucket := index / histogramSubBucketCount
+	subBucket := index % histogramSubBucketCount
+	base := histogramMinValue << uint(bucket)
+	// Compute in floating point: base/histogramSubBucketCount truncates to 0
+	// for the low buckets (base < 2048ns), collapsing every sub-bucket to
+	// the same midpoint and under-reporting percentiles.
+	return base + int64((float64(subBucket)+0.5)*float64(base)/float64(histogramSubBucketCount))
+}
+
+// percentile walks counts accumulating occurrences until it reaches p percent
+// of the total, returning the midpoint of the bucket that crosses it.
+func percentile(counts []int64, p float64) int64 {
+	var total int64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(p / 100 * float64(total)))
+	var running int64
+	for i, c := range counts {
+		running += c
+		if running >= target {
+			return histogramMidpoint(i)
+		}
+	}
+	return histogramMaxValue
+}
+
+// latencyPercentiles holds the percentiles goad reports alongside the
+// existing averages. HasData is false when the histogram is empty, so
+// callers can render "n/a" instead of a misleading 0.000s.
+type latencyPercentiles struct {
+	P50     int64
+	P90     int64
+	P95     int64
+	P99     int64
+	HasData bool
+}
+
+func percentilesFromHistogram(rle []int64) latencyPercentiles {
+	counts := decodeRLE(rle, histogramSize())
+	var total int64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return latencyPercentiles{}
+	}
+	return latencyPercentiles{
+		P50:     percentile(counts, 50),
+		P90:     percentile(counts, 90),
+		P95:     percentile(counts, 95),
+		P99:     percentile(counts, 99),
+		HasData: true,
+	}
+}
+
+// format renders each of the four percentiles as seconds, or all four as
+// "n/a" if the histogram they came from had no samples.
+func (p latencyPercentiles) format() (p50, p90, p95, p99 string) {
+	if !p.HasData {
+		return "n/a", "n/a", "n/a", "n/a"
+	}
+	return fmt.Sprintf("%7.3fs", float64(p.P50)/nano),
+		fmt.Sprintf("%7.3fs", float64(p.P90)/nano),
+		fmt.Sprintf("%7.3fs", float64(p.P95)/nano),
+		fmt.Sprintf("%7.3fs", float64(p.P99)/nano)
+}
+
+// encodeRLE run-length-encodes a counter array as alternating
+// [value, runLength] pairs, keeping the SQS payload small since most of a
+// histogram's buckets are zero.
+func encodeRLE(counts []int64) []int64 {
+	encoded := make([]int64, 0)
+	i := 0
+	for i < len(counts) {
+		v := counts[i]
+		run := int64(1)
+		for i+int(run) < len(counts) && counts[i+int(run)] == v {
+			run++
+		}
+		encoded = append(encoded, v, run)
+		i += int(run)
+	}
+	return encoded
+}
+
+// decodeRLE reverses encodeRLE, padding with zeroes up to size.
+func decodeRLE(encoded []int64, size int) []int64 {
+	counts := make([]int64, 0, size)
+	for i := 0; i+1 < len(encoded); i += 2 {
+		v, run := encoded[i], encoded[i+1]
+		for r := int64(0); r < run; r++ {
+			counts = append(counts, v)
+		}
+	}
+	if len(counts) < size {
+		counts = append(counts, make([]int64, size-len(counts))...)
+	}
+	return counts
+}
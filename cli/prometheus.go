@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/goadapp/goad/queue"
+)
+
+// formatPrometheus renders the aggregated results in Prometheus text
+// exposition format, so a run can be scraped by a Pushgateway or ingested by
+// CI dashboards alongside the JSON output.
+func formatPrometheus(result *queue.RegionsAggData) string {
+	var regions []string
+	for region := range result.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	var buf bytes.Buffer
+
+	buf.WriteString("# HELP goad_requests_total Total requests completed, by region and status.\n")
+	buf.WriteString("# TYPE goad_requests_total counter\n")
+	for _, region := range regions {
+		data := result.Regions[region]
+		for status, count := range data.Statuses {
+			fmt.Fprintf(&buf, "goad_requests_total{region=%q,status=%q} %d\n", region, status, count)
+		}
+	}
+
+	buf.WriteString("# HELP goad_bytes_total Total response bytes read, by region.\n")
+	buf.WriteString("# TYPE goad_bytes_total counter\n")
+	for _, region := range regions {
+		data := result.Regions[region]
+		fmt.Fprintf(&buf, "goad_bytes_total{region=%q} %d\n", region, data.TotBytesRead)
+	}
+
+	buf.WriteString("# HELP goad_timeouts_total Total requests that timed out, by region.\n")
+	buf.WriteString("# TYPE goad_timeouts_total counter\n")
+	for _, region := range regions {
+		data := result.Regions[region]
+		fmt.Fprintf(&buf, "goad_timeouts_total{region=%q} %d\n", region, data.TotalTimedOut)
+	}
+
+	buf.WriteString("# HELP goad_requests_per_second Average requests per second, by region.\n")
+	buf.WriteString("# TYPE goad_requests_per_second gauge\n")
+	for _, region := range regions {
+		data := result.Regions[region]
+		fmt.Fprintf(&buf, "goad_requests_per_second{region=%q} %f\n", region, data.AveReqPerSec)
+	}
+
+	buf.WriteString("# HELP goad_request_duration_seconds Request latency, by region.\n")
+	buf.WriteString("# TYPE goad_request_duration_seconds histogram\n")
+	for _, region := range regions {
+		data := result.Regions[region]
+		writePrometheusHistogram(&buf, region, data.LatencyHistogram)
+	}
+
+	return buf.String()
+}
+
+// writePrometheusHistogram writes cumulative bucket counts (le="...") plus
+// _count and _sum for a region's latency histogram, the full family shape
+// the Prometheus text format expects. _sum is approximated from the
+// histogram's own bucket midpoints, since AggData doesn't track total
+// latency separately.
+func writePrometheusHistogram(buf *bytes.Buffer, region string, rle []int64) {
+	counts := decodeRLE(rle, histogramSize())
+	var cumulative int64
+	var sumSeconds float64
+	bucketCount := histogramBucketCount()
+	for bucket := 0; bucket < bucketCount; bucket++ {
+		start := bucket * histogramSubBucketCount
+		end := start + histogramSubBucketCount
+		for i, c := range counts[start:end] {
+			cumulative += c
+			sumSeconds += float64(c) * float64(histogramMidpoint(start+i)) / nano
+		}
+		upperBound := float64(histogramMinValue<<uint(bucket)) / nano
+		fmt.Fprintf(buf, "goad_request_duration_seconds_bucket{region=%q,le=%q} %d\n", region, fmt.Sprintf("%g", upperBound*2), cumulative)
+	}
+	total := cumulative
+	fmt.Fprintf(buf, "goad_request_duration_seconds_bucket{region=%q,le=\"+Inf\"} %d\n", region, total)
+	fmt.Fprintf(buf, "goad_request_duration_seconds_count{region=%q} %d\n", region, total)
+	fmt.Fprintf(buf, "goad_request_duration_seconds_sum{region=%q} %f\n", region, sumSeconds)
+}
+
+func savePrometheusOutput(path string, result *queue.RegionsAggData) {
+	if len(result.Regions) == 0 {
+		return
+	}
+	err := ioutil.WriteFile(path, []byte(formatPrometheus(result)), 0644)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// pushToGateway POSTs the same Prometheus payload to a Pushgateway, keyed by
+// the job label from --push-gateway-job or the settings file ("goad" if
+// neither sets one).
+func pushToGateway(gatewayURL, job string, result *queue.RegionsAggData) {
+	if len(result.Regions) == 0 {
+		return
+	}
+	url := fmt.Sprintf("%s/metrics/job/%s", gatewayURL, job)
+	resp, err := http.Post(url, "text/plain; version=0.0.4", bytes.NewBufferString(formatPrometheus(result)))
+	if err != nil {
+		fmt.Println("Error pushing to Pushgateway:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		fmt.Printf("Pushgateway returned status %s\n", resp.Status)
+	}
+}
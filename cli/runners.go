@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/goadapp/goad/queue"
+	"github.com/nsf/termbox-go"
+)
+
+// showRunnerPanel toggles the expandable per-runner detail panel in the
+// termbox view, flipped by pressing 'r' in the PollEvent goroutine in start
+// and read from the result-processing loop in start, so it's an int32
+// accessed atomically rather than a plain bool.
+var showRunnerPanel int32
+
+func toggleRunnerPanel() {
+	for {
+		old := atomic.LoadInt32(&showRunnerPanel)
+		if atomic.CompareAndSwapInt32(&showRunnerPanel, old, 1-old) {
+			return
+		}
+	}
+}
+
+func runnerPanelVisible() bool {
+	return atomic.LoadInt32(&showRunnerPanel) != 0
+}
+
+// renderRunnerPanel prints one line per lambda runner in a region, making
+// stragglers and dead lambdas visible instead of hiding them inside the
+// regional average. Returns the y for the next empty line.
+func renderRunnerPanel(data queue.AggData, y int) int {
+	var ids []string
+	for id := range data.Runners {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	headingStr := "     RunnerID     Req/s  TotErrors  LastHeartbeat"
+	renderString(0, y, headingStr, coldef|termbox.AttrBold, coldef)
+	y++
+	for _, id := range ids {
+		runner := data.Runners[id]
+		age := time.Since(runner.LastHeartbeat).Round(time.Second)
+		resultStr := fmt.Sprintf("%12s %9.2f %10d  %12s", id, runner.ReqPerSec, runner.TotalErrors, age)
+		renderString(0, y, resultStr, coldef, coldef)
+		y++
+	}
+	return y
+}
+
+// runnerJSON is the JSON shape for a single runner's contribution to a
+// region, included in the output's "runners" array for post-hoc analysis.
+type runnerJSON struct {
+	RunnerID      string
+	ReqPerSec     float64
+	TotalErrors   int
+	LastHeartbeat time.Time
+}
+
+func runnersJSON(data queue.AggData) []runnerJSON {
+	var runners []runnerJSON
+	for id, runner := range data.Runners {
+		runners = append(runners, runnerJSON{
+			RunnerID:      id,
+			ReqPerSec:     runner.ReqPerSec,
+			TotalErrors:   runner.TotalErrors,
+			LastHeartbeat: runner.LastHeartbeat,
+		})
+	}
+	sort.Slice(runners, func(i, j int) bool { return runners[i].RunnerID < runners[j].RunnerID })
+	return runners
+}
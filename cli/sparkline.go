@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/goadapp/goad/queue"
+)
+
+// rollingWindowSize caps how many 1s samples are kept per region, giving the
+// sparkline and rolling rates a 60s trailing view of the run.
+const rollingWindowSize = 60
+
+// regionSnapshot is a single (timestamp, cumulative counters) sample of a
+// region's AggData, taken once per second by the sample ticker in start().
+type regionSnapshot struct {
+	at        time.Time
+	totalReqs int
+	totBytes  int64
+	totErrors int
+}
+
+// regionHistory is a ring buffer of regionSnapshot used to turn the
+// cumulative totals in queue.AggData into windowed, per-second rates.
+type regionHistory struct {
+	snapshots []regionSnapshot
+}
+
+// regionHistories holds the rolling window for every region seen so far,
+// keyed by region name. Populated in start() and read from there and from
+// printSummary/saveJSONSummary once the run finishes.
+var regionHistories = make(map[string]*regionHistory)
+
+func recordSnapshot(region string, data queue.AggData, at time.Time) {
+	h, ok := regionHistories[region]
+	if !ok {
+		h = &regionHistory{}
+		regionHistories[region] = h
+	}
+	h.snapshots = append(h.snapshots, regionSnapshot{at: at, totalReqs: data.TotalReqs, totBytes: data.TotBytesRead, totErrors: totErrors(&data)})
+	if len(h.snapshots) > rollingWindowSize {
+		h.snapshots = h.snapshots[len(h.snapshots)-rollingWindowSize:]
+	}
+}
+
+// rates returns the requests/sec, bytes/sec and errors/sec between the two
+// most recent snapshots.
+func (h *regionHistory) rates() (reqPerSec, bytesPerSec, errPerSec float64) {
+	if h == nil || len(h.snapshots) < 2 {
+		return 0, 0, 0
+	}
+	prev := h.snapshots[len(h.snapshots)-2]
+	last := h.snapshots[len(h.snapshots)-1]
+	elapsed := last.at.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		return 0, 0, 0
+	}
+	reqPerSec = float64(last.totalReqs-prev.totalReqs) / elapsed
+	bytesPerSec = float64(last.totBytes-prev.totBytes) / elapsed
+	errPerSec = float64(last.totErrors-prev.totErrors) / elapsed
+	return
+}
+
+// reqRateSeries turns the snapshot ring buffer into a series of per-second
+// request rates, one per consecutive snapshot pair.
+func (h *regionHistory) reqRateSeries() []float64 {
+	if h == nil || len(h.snapshots) < 2 {
+		return nil
+	}
+	series := make([]float64, 0, len(h.snapshots)-1)
+	for i := 1; i < len(h.snapshots); i++ {
+		elapsed := h.snapshots[i].at.Sub(h.snapshots[i-1].at).Seconds()
+		if elapsed <= 0 {
+			series = append(series, 0)
+			continue
+		}
+		series = append(series, float64(h.snapshots[i].totalReqs-h.snapshots[i-1].totalReqs)/elapsed)
+	}
+	return series
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders values as a single line of block characters scaled
+// between the series' own min and max, the same shape-of-the-run view
+// streaming stats printers use for windowed rate reporting.
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	span := max - min
+	runes := make([]rune, len(values))
+	for i, v := range values {
+		if span == 0 {
+			runes[i] = sparkBlocks[0]
+			continue
+		}
+		idx := int((v - min) / span * float64(len(sparkBlocks)-1))
+		runes[i] = sparkBlocks[idx]
+	}
+	return string(runes)
+}
+
+// asciiChart renders values as a multi-row bar chart using '*' columns, for
+// the headless (no TTY) case where block-character sparklines may not render.
+func asciiChart(values []float64, rows int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	max := values[0]
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+	var lines []string
+	for row := rows; row >= 1; row-- {
+		threshold := max * float64(row) / float64(rows)
+		var line strings.Builder
+		for _, v := range values {
+			if v >= threshold {
+				line.WriteByte('*')
+			} else {
+				line.WriteByte(' ')
+			}
+		}
+		lines = append(lines, line.String())
+	}
+	return strings.Join(lines, "\n")
+}